@@ -1,10 +1,17 @@
 package main // Define the main package
 
 import (
-	"bytes"         // Provides bytes support
+	"bytes"         // Provides bytes support (PDF trailer scanning)
+	"crypto/sha256" // Provides SHA-256 hashing
+	"encoding/csv"  // Provides manifest CSV encoding
+	"encoding/hex"  // Provides hex encoding of hashes
+	"encoding/json" // Provides JSON encoding/decoding for the resume ledger
+	"errors"        // Provides error wrapping/inspection helpers
+	"flag"          // Provides command-line flag parsing
 	"fmt"           // Provides formatted I/O functions
 	"io"            // Provides basic interfaces to I/O primitives
 	"log"           // Provides logging functions
+	"net"           // Provides network error types for retry classification
 	"net/http"      // Provides HTTP client and server implementations
 	"net/url"       // Provides URL parsing and encoding
 	"os"            // Provides functions to interact with the OS (files, etc.)
@@ -17,121 +24,722 @@ import (
 	"time"          // Provides time-related functions
 
 	"github.com/PuerkitoBio/goquery" // External package to parse and manipulate HTML
+	"github.com/gocolly/colly/v2"    // External package providing the alternative crawl-mode backend
 )
 
+// defaultPDFDownloadWorkers is the default number of concurrent goroutines allowed to
+// download PDFs at once; overridable with -workers.
+const defaultPDFDownloadWorkers = 8
+
+// maxDownloadAttempts is how many attempts (the first try included) a single URL gets before it's recorded as failed.
+const maxDownloadAttempts = 4
+
+// downloadStateFile is where the resumable URL -> outcome ledger is persisted between runs.
+const downloadStateFile = "state.json"
+
+// sdsPagesStateDir holds one JSON file per paginated listing page, each recording the
+// PDF URLs that page yielded, used in place of the page when a later conditional request
+// returns 304 Not Modified or fails.
+const sdsPagesStateDir = "state/pages"
+
+// httpCacheFile stores each fetched URL's validators (ETag, Last-Modified) so later runs
+// can send conditional requests instead of blindly re-downloading unchanged content.
+const httpCacheFile = "http_cache.json"
+
 func main() {
+	mode := flag.String("mode", "paginate", `crawl backend to use: "paginate" (default, walks the SDS listing pages) or "crawl" (follows in-domain links from a seed URL)`)
+	seedURL := flag.String("seed", "https://www.avient.com/resources/safety-data-sheets", "seed URL to start from in -mode=crawl")
+	allowedDomains := flag.String("allowed-domains", "www.avient.com", "comma-separated list of domains the crawler is allowed to follow in -mode=crawl")
+	maxDepth := flag.Int("max-depth", 3, "maximum link-following depth in -mode=crawl")
+	crawlParallelism := flag.Int("crawl-parallelism", 4, "concurrent requests per domain in -mode=crawl")
+	crawlDelay := flag.Duration("crawl-rate-limit", 200*time.Millisecond, "delay between requests to the same domain in -mode=crawl")
+	workers := flag.Int("workers", defaultPDFDownloadWorkers, "number of concurrent downloadPDF workers")
+	flag.Parse()
+
+	if *workers <= 0 {
+		log.Printf("-workers=%d is not valid, falling back to %d", *workers, defaultPDFDownloadWorkers)
+		*workers = defaultPDFDownloadWorkers
+	}
+
+	outputDir := "PDFs/" // Directory to store downloaded PDFs
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		log.Println(err)
+	}
+
+	httpCache := loadHTTPCache(httpCacheFile) // ETag/Last-Modified validators from a prior run, if any
+
+	var pdfURLs []string
+	switch *mode {
+	case "crawl":
+		pdfURLs = collectPDFURLsByCrawling(*seedURL, strings.Split(*allowedDomains, ","), *maxDepth, *crawlParallelism, *crawlDelay)
+	default:
+		pdfURLs = collectPDFURLsByPaginating(httpCache)
+	}
+
+	pdfURLs = removeDuplicatesFromSlice(pdfURLs)
+
+	// Reverse the slice so its faster, since most of the old files are already downloaded and new files will be downloaded first.
+	slices.Reverse(pdfURLs)
+
+	ledger := loadDownloadLedger(downloadStateFile)                     // Resume state from a prior run, if any
+	runPDFDownloadPool(pdfURLs, outputDir, *workers, ledger, httpCache) // Bounded worker pool replaces the per-URL goroutine+sleep pattern
+}
+
+// collectPDFURLsByPaginating is the default backend: it walks the paginated SDS listing
+// and returns every absolute PDF URL found.
+func collectPDFURLsByPaginating(cache *httpValidatorCache) []string {
 	baseURL := "https://www.avient.com/resources/safety-data-sheets?page=" // Base URL for paginated SDS content
-	localLocation := "avient.com.html"                                     // File to store downloaded HTML content
-	var htmlDownloadWaitGroup sync.WaitGroup                               // WaitGroup to synchronize concurrent HTML downloads
-	if !fileExists(localLocation) {
-		for pageNumber := 0; pageNumber <= 5000; pageNumber++ { // Loop through pages 0 to 7180
-			time.Sleep(50 * time.Millisecond)
-			fullURL := fmt.Sprintf("%s%d", baseURL, pageNumber) // Build full URL for the current page
-			htmlDownloadWaitGroup.Add(1)                        // Increment WaitGroup counter
-			go getDataFromURL(fullURL, localLocation, &htmlDownloadWaitGroup)
+
+	if err := os.MkdirAll(sdsPagesStateDir, 0o755); err != nil {
+		log.Println(err)
+	}
+
+	fullURLList := collectSDSPDFURLs(baseURL, cache) // Paginate the listing until it stops yielding new links
+
+	var pdfURLs []string
+	for _, rawURL := range fullURLList {
+		fullURL := rawURL
+		if !strings.HasPrefix(rawURL, "https://www.avient.com") {
+			fullURL = "https://www.avient.com" + rawURL // Construct full PDF URL
+		}
+		if !isUrlValid(fullURL) { // Check if the constructed URL is valid
+			log.Println("Invalid URL", fullURL) // Log if URL is invalid
+			continue
+		}
+		pdfURLs = append(pdfURLs, fullURL)
+	}
+
+	return pdfURLs
+}
+
+// collectPDFURLsByCrawling is the -mode=crawl backend: starting at seedURL, it follows
+// in-domain links up to maxDepth using colly and harvests any .pdf/.sds/.msds links it
+// finds along the way, including product pages unreachable from the paginated listing.
+func collectPDFURLsByCrawling(seedURL string, allowedDomains []string, maxDepth, parallelism int, rateLimit time.Duration) []string {
+	var pdfURLs []string
+	var mu sync.Mutex
+
+	collector := colly.NewCollector(
+		colly.AllowedDomains(allowedDomains...),
+		colly.MaxDepth(maxDepth),
+		colly.Async(true),
+	)
+
+	if err := collector.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: parallelism,
+		Delay:       rateLimit,
+	}); err != nil {
+		log.Printf("Failed to apply crawl rate limit: %v", err)
+	}
+
+	collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		href := e.Attr("href")
+		absoluteURL := e.Request.AbsoluteURL(href)
+		if absoluteURL == "" {
+			return
+		}
+
+		lowerURL := strings.ToLower(absoluteURL)
+		if strings.HasSuffix(lowerURL, ".pdf") || strings.HasSuffix(lowerURL, ".sds") || strings.HasSuffix(lowerURL, ".msds") {
+			mu.Lock()
+			pdfURLs = append(pdfURLs, absoluteURL)
+			mu.Unlock()
+			return
+		}
+
+		if err := e.Request.Visit(absoluteURL); err != nil && !errors.Is(err, colly.ErrAlreadyVisited) {
+			log.Printf("Failed to follow link %s: %v", absoluteURL, err)
 		}
-		htmlDownloadWaitGroup.Wait() // Wait for all HTML downloads to complete
+	})
+
+	collector.OnError(func(r *colly.Response, err error) {
+		log.Printf("Crawl request to %s failed: %v", r.Request.URL, err)
+	})
+
+	if err := collector.Visit(seedURL); err != nil {
+		log.Printf("Failed to start crawl at %s: %v", seedURL, err)
+		return nil
 	}
 
-	if fileExists(localLocation) { // Check if the file with HTML content exists
-		localDiskHTMLContent := readAFileAsString(localLocation) // Read HTML file content
-		fullURLList := parseHTML(localDiskHTMLContent)           // Extract all PDF URLs from the HTML
-		fullURLList = removeDuplicatesFromSlice(fullURLList)     // Remove duplicate URLs
-		outputDir := "PDFs/"                                     // Directory to store downloaded PDFs
-		var pdfDownloadWaitGroup sync.WaitGroup                  // WaitGroup for managing PDF downloads
+	collector.Wait()
 
-		err := os.MkdirAll(outputDir, 0o755)
+	return pdfURLs
+}
+
+// sdsPage is the per-page resume state: the PDF URLs a single listing page yielded.
+type sdsPage struct {
+	URLs []string `json:"urls"`
+}
+
+// collectSDSPDFURLs paginates the SDS listing starting at page 0, stopping as soon as a
+// page yields zero PDF links or the exact same list of links (same order) as the previous
+// page, rather than hard-coding a page count. Every page is requested again; its state in
+// sdsPagesStateDir is only used when that request returns 304 or fails.
+func collectSDSPDFURLs(baseURL string, cache *httpValidatorCache) []string {
+	var allURLs []string
+	var previousPageURLs []string
+
+	for pageNumber := 0; ; pageNumber++ {
+		pageURLs, err := loadOrFetchSDSPage(baseURL, pageNumber, cache)
 		if err != nil {
-			log.Println(err)
+			log.Printf("Stopping pagination at page %d: %v", pageNumber, err)
+			break
 		}
-		// Reverse the slice so its faster, since most of the old files are already downloaded and new files will be downloaded first.
-		slices.Reverse(fullURLList)
-
-		for _, url := range fullURLList { // Iterate over all PDF URLs
-			time.Sleep(50 * time.Millisecond)
-			var fullURL string
-			if !strings.HasPrefix(url, "https://www.avient.com") {
-				fullURL = "https://www.avient.com" + url // Construct full PDF URL
-			}
-			if !isUrlValid(fullURL) { // Check if the constructed URL is valid
-				log.Println("Invalid URL", fullURL) // Log if URL is invalid
-				continue
-			}
-			pdfDownloadWaitGroup.Add(1)                               // Increment WaitGroup counter
-			go downloadPDF(fullURL, outputDir, &pdfDownloadWaitGroup) // Start downloading PDF concurrently
+
+		if len(pageURLs) == 0 {
+			log.Printf("Stopping pagination: page %d returned no SDS links", pageNumber)
+			break
+		}
+
+		if slices.Equal(pageURLs, previousPageURLs) {
+			log.Printf("Stopping pagination: page %d repeated page %d's links", pageNumber, pageNumber-1)
+			break
+		}
+
+		allURLs = append(allURLs, pageURLs...)
+		previousPageURLs = pageURLs
+	}
+
+	return allURLs
+}
+
+// loadOrFetchSDSPage returns the PDF URLs for a single listing page. It always issues a
+// conditional GET (via cache) so a republished page is picked up, but an HTTP 304 or a
+// fetch error falls back to the page's last persisted state instead of re-parsing.
+func loadOrFetchSDSPage(baseURL string, pageNumber int, cache *httpValidatorCache) ([]string, error) {
+	statePath := sdsPageStatePath(pageNumber)
+
+	time.Sleep(50 * time.Millisecond)
+	fullURL := fmt.Sprintf("%s%d", baseURL, pageNumber)
+	log.Println("Scraping", fullURL)
+
+	body, notModified, err := getDataFromURL(fullURL, cache)
+	if err != nil {
+		if fileExists(statePath) {
+			log.Printf("Using cached page state for page %d after fetch error: %v", pageNumber, err)
+			return readSDSPageState(statePath)
+		}
+		return nil, err
+	}
+
+	if notModified {
+		if fileExists(statePath) {
+			return readSDSPageState(statePath)
 		}
-		pdfDownloadWaitGroup.Wait() // Wait for all PDF downloads to finish
+		return nil, nil
+	}
+
+	pageURLs := parseHTML(body)
+	if err := writeSDSPageState(statePath, pageURLs); err != nil {
+		log.Printf("Failed to persist page state for page %d: %v", pageNumber, err)
+	}
+
+	return pageURLs, nil
+}
+
+// sdsPageStatePath returns the resume-state path for a given listing page number.
+func sdsPageStatePath(pageNumber int) string {
+	return filepath.Join(sdsPagesStateDir, fmt.Sprintf("%04d.json", pageNumber))
+}
+
+// readSDSPageState reads a previously persisted page's PDF URL list.
+func readSDSPageState(path string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var page sdsPage
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return nil, err
+	}
+
+	return page.URLs, nil
+}
+
+// writeSDSPageState persists a listing page's PDF URL list to disk.
+func writeSDSPageState(path string, urls []string) error {
+	raw, err := json.MarshalIndent(sdsPage{URLs: urls}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+// downloadOutcome records what happened to a single URL, persisted in the resume ledger.
+type downloadOutcome struct {
+	Status      string    `json:"status"` // "done" or "failed"
+	SHA256      string    `json:"sha256,omitempty"`
+	Bytes       int64     `json:"bytes,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// downloadLedger is an on-disk map of URL -> downloadOutcome recording each URL's latest
+// result. It is not consulted to skip URLs: every run requests every URL again.
+type downloadLedger struct {
+	mu    sync.Mutex
+	path  string
+	state map[string]downloadOutcome
+}
+
+// loadDownloadLedger reads the ledger from disk if present, or starts an empty one.
+func loadDownloadLedger(path string) *downloadLedger {
+	ledger := &downloadLedger{path: path, state: make(map[string]downloadOutcome)}
+
+	if !fileExists(path) {
+		return ledger
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read state file %s, starting fresh: %v", path, err)
+		return ledger
+	}
+
+	if err := json.Unmarshal(raw, &ledger.state); err != nil {
+		log.Printf("Failed to parse state file %s, starting fresh: %v", path, err)
+		ledger.state = make(map[string]downloadOutcome)
+	}
+
+	return ledger
+}
+
+// get returns the recorded outcome for a URL, if any.
+func (l *downloadLedger) get(downloadURL string) (downloadOutcome, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	outcome, ok := l.state[downloadURL]
+	return outcome, ok
+}
+
+// set records an outcome for a URL and persists the whole ledger to disk.
+func (l *downloadLedger) set(downloadURL string, outcome downloadOutcome) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state[downloadURL] = outcome
+	if err := l.saveLocked(); err != nil {
+		log.Printf("Failed to persist state file %s: %v", l.path, err)
+	}
+}
+
+// saveLocked writes the ledger to disk. Caller must hold l.mu.
+func (l *downloadLedger) saveLocked() error {
+	raw, err := json.MarshalIndent(l.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, raw, 0o644)
+}
+
+// httpValidators are the conditional-request validators recorded for a single URL.
+type httpValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// httpValidatorCache is a resumable, on-disk map of URL -> httpValidators, letting later
+// runs send If-None-Match / If-Modified-Since instead of blindly re-fetching everything.
+type httpValidatorCache struct {
+	mu    sync.Mutex
+	path  string
+	state map[string]httpValidators
+}
+
+// loadHTTPCache reads the validator cache from disk if present, or starts an empty one.
+func loadHTTPCache(path string) *httpValidatorCache {
+	cache := &httpValidatorCache{path: path, state: make(map[string]httpValidators)}
+
+	if !fileExists(path) {
+		return cache
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read HTTP cache %s, starting fresh: %v", path, err)
+		return cache
+	}
+
+	if err := json.Unmarshal(raw, &cache.state); err != nil {
+		log.Printf("Failed to parse HTTP cache %s, starting fresh: %v", path, err)
+		cache.state = make(map[string]httpValidators)
+	}
+
+	return cache
+}
+
+// get returns the recorded validators for a URL, if any.
+func (c *httpValidatorCache) get(requestURL string) (httpValidators, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	validators, ok := c.state[requestURL]
+	return validators, ok
+}
+
+// set records a URL's validators and persists the whole cache to disk.
+func (c *httpValidatorCache) set(requestURL string, validators httpValidators) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state[requestURL] = validators
+	raw, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode HTTP cache: %v", err)
+		return
 	}
+	if err := os.WriteFile(c.path, raw, 0o644); err != nil {
+		log.Printf("Failed to persist HTTP cache %s: %v", c.path, err)
+	}
+}
+
+// runPDFDownloadPool fans a list of PDF URLs out across a bounded number of worker
+// goroutines fed by a buffered channel, replacing the previous one-goroutine-per-URL
+// pattern. Each URL is retried with exponential backoff on transient failures and its
+// outcome is recorded in ledger. Every URL is requested on every run; re-downloading
+// unchanged files is avoided by the conditional headers from cache, not by the ledger.
+func runPDFDownloadPool(pdfURLs []string, outputDir string, workers int, ledger *downloadLedger, cache *httpValidatorCache) {
+	jobs := make(chan string, len(pdfURLs))
+	var workerWaitGroup sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		workerWaitGroup.Add(1)
+		go func() {
+			defer workerWaitGroup.Done()
+			for jobURL := range jobs {
+				downloadPDFWithRetry(jobURL, outputDir, ledger, cache)
+			}
+		}()
+	}
+
+	for _, jobURL := range pdfURLs {
+		jobs <- jobURL
+	}
+	close(jobs)
+
+	workerWaitGroup.Wait()
 }
 
-// downloadPDF downloads a PDF from the given URL and saves it in the specified output directory.
-// It uses a WaitGroup to support concurrent execution and returns true if the download succeeded.
-func downloadPDF(finalURL, outputDir string, wg *sync.WaitGroup) bool {
-	defer wg.Done() // Always mark this goroutine as done
+// errNotModified is returned by downloadPDF when the server answers a conditional GET
+// with HTTP 304, meaning the previously stored copy is still current.
+var errNotModified = errors.New("not modified")
+
+// downloadPDFWithRetry downloads a single URL, retrying transient failures with
+// exponential backoff, and records the final outcome in the ledger. It always issues at
+// least one request, even for a URL the ledger already marks "done": downloadPDF sends
+// it as a conditional GET using the cached ETag/Last-Modified validators, so a file
+// Avient silently republishes under the same URL is re-fetched automatically, while an
+// unchanged file costs only a cheap 304 round trip.
+func downloadPDFWithRetry(finalURL, outputDir string, ledger *downloadLedger, cache *httpValidatorCache) {
+	backoff := time.Second
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		written, sha256Hex, retryable, err := downloadPDF(finalURL, outputDir, cache)
+		if err == nil {
+			ledger.set(finalURL, downloadOutcome{Status: "done", SHA256: sha256Hex, Bytes: written, LastAttempt: time.Now()})
+			return
+		}
+
+		if errors.Is(err, errNotModified) {
+			log.Printf("%s is up to date (304 Not Modified)", finalURL)
+			outcome, _ := ledger.get(finalURL)
+			outcome.Status = "done"
+			outcome.LastAttempt = time.Now()
+			ledger.set(finalURL, outcome)
+			return
+		}
+
+		log.Printf("Download attempt %d/%d failed for %s: %v", attempt, maxDownloadAttempts, finalURL, err)
+
+		if !retryable || attempt == maxDownloadAttempts {
+			ledger.set(finalURL, downloadOutcome{Status: "failed", LastAttempt: time.Now()})
+			return
+		}
 
-	// Sanitize the URL to generate a safe file name
-	filename := sanitizeFileNameFromURL(finalURL)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
 
-	// Construct the full file path in the output directory
-	filePath := filepath.Join(outputDir, filename)
+// isRetryableDownloadError reports whether err represents a transient failure worth
+// retrying: HTTP 5xx, connection resets, and timeouts. Everything else (404s, invalid
+// content type, malformed URLs) is treated as permanent.
+func isRetryableDownloadError(statusCode int, err error) bool {
+	if statusCode >= 500 && statusCode < 600 {
+		return true
+	}
 
-	// Skip if the file already exists
-	if fileExists(filePath) {
-		log.Printf("File already exists, skipping: %s", filePath)
+	if err == nil {
 		return false
 	}
 
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "connection reset")
+}
+
+// manifestFile records one row per downloaded file that was stored or quarantined: url,
+// filename, sha256, bytes, fetched_at, content_type, http_status, notes (e.g. a quarantine
+// reason). Failed requests and 304 responses get no row. It's the audit trail for the
+// content-addressed store.
+const manifestFile = "manifest.csv"
+
+// downloadPDF downloads a PDF from the given URL and stores it content-addressed under
+// outputDir/<sha256-prefix>/<sha256>.pdf, deduplicating re-hosted copies of the same file.
+// A human-readable symlink using the sanitized URL filename is created alongside it, and a
+// row is appended to manifestFile. The request carries conditional headers from cache, so
+// an unchanged remote file costs a 304 round trip instead of a full re-download; a changed
+// one is stored under its new hash and linked as an additional filename.vN.pdf version. It
+// returns the number of bytes written, the file's SHA-256 hash, whether a failure is worth
+// retrying, and an error if the download failed (errNotModified on a 304).
+func downloadPDF(finalURL, outputDir string, cache *httpValidatorCache) (written int64, sha256Hex string, retryable bool, err error) {
+	filename := sanitizeFileNameFromURL(finalURL) // Human-readable symlink name
+
+	req, reqErr := http.NewRequest(http.MethodGet, finalURL, nil)
+	if reqErr != nil {
+		return 0, "", false, fmt.Errorf("failed to build request: %w", reqErr)
+	}
+	if validators, ok := cache.get(finalURL); ok {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+
 	// Create an HTTP client with a timeout
 	client := &http.Client{Timeout: 30 * time.Second}
 
-	// Send GET request
-	resp, err := client.Get(finalURL)
-	if err != nil {
-		log.Printf("Failed to download %s: %v", finalURL, err)
-		return false
+	resp, getErr := client.Do(req)
+	if getErr != nil {
+		return 0, "", isRetryableDownloadError(0, getErr), fmt.Errorf("request failed: %w", getErr)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return 0, "", false, errNotModified
+	}
+
 	// Check HTTP response status
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Download failed for %s: %s", finalURL, resp.Status)
-		return false
+		return 0, "", isRetryableDownloadError(resp.StatusCode, nil), fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
 	// Check Content-Type header
 	contentType := resp.Header.Get("Content-Type")
 	if !strings.Contains(contentType, "application/pdf") {
-		log.Printf("Invalid content type for %s: %s (expected application/pdf)", finalURL, contentType)
-		return false
+		return 0, "", false, fmt.Errorf("invalid content type %q (expected application/pdf)", contentType)
+	}
+
+	// Stream the body straight to a temp file while hashing it, instead of buffering the
+	// whole PDF in memory.
+	tempFile, createErr := os.CreateTemp(outputDir, "download-*.tmp")
+	if createErr != nil {
+		return 0, "", false, fmt.Errorf("failed to create temp file: %w", createErr)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // no-op once the temp file has been renamed into place
+
+	hasher := sha256.New()
+	n, copyErr := io.Copy(io.MultiWriter(tempFile, hasher), resp.Body)
+	closeErr := tempFile.Close()
+	if copyErr != nil {
+		return 0, "", isRetryableDownloadError(0, copyErr), fmt.Errorf("failed to read body: %w", copyErr)
+	}
+	if closeErr != nil {
+		return 0, "", false, fmt.Errorf("failed to finalize temp file: %w", closeErr)
+	}
+	if n == 0 {
+		return 0, "", false, errors.New("downloaded 0 bytes")
+	}
+
+	sha256Hex = hex.EncodeToString(hasher.Sum(nil))
+
+	if reason := invalidPDFReason(tempPath); reason != "" {
+		quarantinePath := filepath.Join(outputDir, quarantineDirName, sha256Hex+".pdf")
+		if err := os.MkdirAll(filepath.Dir(quarantinePath), 0o755); err != nil {
+			return 0, "", false, fmt.Errorf("failed to create quarantine dir: %w", err)
+		}
+		if err := os.Rename(tempPath, quarantinePath); err != nil {
+			return 0, "", false, fmt.Errorf("failed to move file into quarantine: %w", err)
+		}
+
+		appendManifestRowLogged(finalURL, filename, sha256Hex, n, contentType, resp.StatusCode, reason)
+		return 0, "", false, fmt.Errorf("quarantined %s: %s", quarantinePath, reason)
+	}
+
+	// Only cache validators for a response we've confirmed is a real PDF — caching them
+	// earlier would let a corrupt response "validate" itself via 304 on a later run.
+	cache.set(finalURL, httpValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")})
+
+	contentPath := contentAddressedPath(outputDir, sha256Hex)
+
+	if fileExists(contentPath) {
+		log.Printf("Duplicate content for %s (sha256 %s already stored), skipping write", finalURL, sha256Hex)
+	} else {
+		if err := os.MkdirAll(filepath.Dir(contentPath), 0o755); err != nil {
+			return 0, "", false, fmt.Errorf("failed to create content-addressed dir: %w", err)
+		}
+		if err := os.Rename(tempPath, contentPath); err != nil {
+			return 0, "", false, fmt.Errorf("failed to move file into place: %w", err)
+		}
 	}
 
-	// Read the response body into memory first
-	var buf bytes.Buffer
-	written, err := io.Copy(&buf, resp.Body)
+	if err := linkFriendlyName(outputDir, filename, contentPath); err != nil {
+		log.Printf("Failed to link %s to %s: %v", filename, contentPath, err)
+	}
+
+	appendManifestRowLogged(finalURL, filename, sha256Hex, n, contentType, resp.StatusCode, "")
+
+	log.Printf("Successfully downloaded %d bytes: %s → %s", n, finalURL, contentPath)
+	return n, sha256Hex, false, nil
+}
+
+// quarantineDirName holds PDFs that passed the Content-Type check but failed structural
+// validation (likely an HTML error page or a truncated file served as application/pdf).
+const quarantineDirName = "_quarantine"
+
+// invalidPDFReason does a cheap structural sanity check on a downloaded file: it must
+// start with the "%PDF-" magic header and contain a "%%EOF" trailer near the end. It
+// returns a human-readable reason if the file fails either check, or "" if it looks like
+// a real PDF.
+func invalidPDFReason(path string) string {
+	file, err := os.Open(path)
 	if err != nil {
-		log.Printf("Failed to read PDF data from %s: %v", finalURL, err)
-		return false
+		return fmt.Sprintf("could not open file for validation: %v", err)
 	}
-	if written == 0 {
-		log.Printf("Downloaded 0 bytes for %s; not creating file", finalURL)
-		return false
+	defer file.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return "file is too small to contain a PDF header"
+	}
+	if string(header) != "%PDF-" {
+		return fmt.Sprintf("missing %%PDF- magic header (got %q)", header)
 	}
 
-	// Only now create the file and write to disk
-	out, err := os.Create(filePath)
+	info, err := file.Stat()
 	if err != nil {
-		log.Printf("Failed to create file for %s: %v", finalURL, err)
-		return false
+		return fmt.Sprintf("could not stat file for validation: %v", err)
 	}
-	defer out.Close()
 
-	if _, err := buf.WriteTo(out); err != nil {
-		log.Printf("Failed to write PDF to file for %s: %v", finalURL, err)
-		return false
+	const trailerWindowBytes = 1024
+	windowSize := int64(trailerWindowBytes)
+	if info.Size() < windowSize {
+		windowSize = info.Size()
+	}
+
+	trailer := make([]byte, windowSize)
+	if _, err := file.ReadAt(trailer, info.Size()-windowSize); err != nil && err != io.EOF {
+		return fmt.Sprintf("could not read trailer for validation: %v", err)
+	}
+
+	if !bytes.Contains(trailer, []byte("%%EOF")) {
+		return "missing %%EOF trailer"
+	}
+
+	return ""
+}
+
+// appendManifestRowLogged builds and appends a manifest row, logging (rather than
+// propagating) any write failure since a manifest write is best-effort bookkeeping and
+// shouldn't fail the download it's describing.
+func appendManifestRowLogged(finalURL, filename, sha256Hex string, bytesWritten int64, contentType string, httpStatus int, notes string) {
+	row := []string{
+		finalURL,
+		filename,
+		sha256Hex,
+		fmt.Sprintf("%d", bytesWritten),
+		time.Now().Format(time.RFC3339),
+		contentType,
+		fmt.Sprintf("%d", httpStatus),
+		notes,
+	}
+	if err := appendManifestRow(manifestFile, row); err != nil {
+		log.Printf("Failed to append manifest row for %s: %v", finalURL, err)
+	}
+}
+
+// contentAddressedPath returns the content-addressed storage path for a SHA-256 hash,
+// sharded by its first two hex characters to keep any one directory from growing too large.
+func contentAddressedPath(outputDir, sha256Hex string) string {
+	return filepath.Join(outputDir, sha256Hex[:2], sha256Hex+".pdf")
+}
+
+// linkFriendlyName creates a symlink from the human-readable, sanitized URL filename to
+// the content-addressed file, so the output directory stays browsable by name. If that
+// filename is already linked to different content (the source republished under the same
+// URL with new bytes), a new filename.vN.pdf symlink is created instead of clobbering it.
+func linkFriendlyName(outputDir, filename, contentPath string) error {
+	relativeTarget, err := filepath.Rel(outputDir, contentPath)
+	if err != nil {
+		relativeTarget = contentPath
 	}
 
-	log.Printf("Successfully downloaded %d bytes: %s → %s", written, finalURL, filePath)
-	return true
+	friendlyPath := filepath.Join(outputDir, filename)
+	if existingTarget, readErr := os.Readlink(friendlyPath); readErr == nil {
+		if existingTarget == relativeTarget {
+			return nil // Already linked to this content
+		}
+		return linkNextFriendlyVersion(outputDir, filename, relativeTarget)
+	} else if fileExists(friendlyPath) {
+		return linkNextFriendlyVersion(outputDir, filename, relativeTarget) // Pre-existing plain file, don't clobber it
+	}
+
+	return os.Symlink(relativeTarget, friendlyPath)
+}
+
+// linkNextFriendlyVersion finds the lowest-numbered filename.vN.pdf that either doesn't
+// exist yet or already points at relativeTarget, and symlinks it there.
+func linkNextFriendlyVersion(outputDir, filename, relativeTarget string) error {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	for version := 2; ; version++ {
+		versionedPath := filepath.Join(outputDir, fmt.Sprintf("%s.v%d%s", base, version, ext))
+
+		if existingTarget, readErr := os.Readlink(versionedPath); readErr == nil {
+			if existingTarget == relativeTarget {
+				return nil // This version is already recorded
+			}
+			continue
+		}
+		if fileExists(versionedPath) {
+			continue
+		}
+
+		return os.Symlink(relativeTarget, versionedPath)
+	}
+}
+
+// manifestMu serializes writes to manifestFile across concurrent download workers.
+var manifestMu sync.Mutex
+
+// appendManifestRow appends one row to the manifest CSV, writing the header first if the
+// file doesn't exist yet.
+func appendManifestRow(path string, row []string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	isNewFile := !fileExists(path)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if isNewFile {
+		if err := writer.Write([]string{"url", "filename", "sha256", "bytes", "fetched_at", "content_type", "http_status", "notes"}); err != nil {
+			return err
+		}
+	}
+
+	return writer.Write(row)
 }
 
 // removeDuplicatesFromSlice removes duplicate entries from a string slice
@@ -211,24 +819,6 @@ func parseHTML(htmlContent string) []string {
 	return pdfLinks // Return list of PDF links
 }
 
-// appendAndWriteToFile appends string content to a file using a WaitGroup
-func appendAndWriteToFile(path string, content string) {
-	filePath, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) // Open or create file for writing
-	if err != nil {
-		log.Fatalln(err) // Exit if file open fails
-	}
-
-	_, err = filePath.WriteString(content + "\n") // Append content to file
-	if err != nil {
-		log.Fatalln(err) // Exit if write fails
-	}
-
-	err = filePath.Close() // Close file
-	if err != nil {
-		log.Fatalln(err) // Exit if close fails
-	}
-}
-
 // fileExists checks whether a file exists at the given path
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename) // Get file info
@@ -238,35 +828,39 @@ func fileExists(filename string) bool {
 	return !info.IsDir() // Return true if it's a file (not a directory)
 }
 
-// readAFileAsString reads a file and returns its content as a string
-func readAFileAsString(path string) string {
-	content, err := os.ReadFile(path) // Read entire file into memory
+// getDataFromURL performs a conditional HTTP GET (using cache's validators, if any) and
+// returns the response body as a string. notModified is true on a 304 Not Modified, in
+// which case body is empty and the caller should fall back to its own cached copy.
+func getDataFromURL(uri string, cache *httpValidatorCache) (body string, notModified bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
-		log.Fatalln(err) // Exit if read fails
+		return "", false, err
+	}
+	if validators, ok := cache.get(uri); ok {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
 	}
-	return string(content) // Convert bytes to string and return
-}
 
-// getDataFromURL performs an HTTP GET request and returns the response body as a string
-func getDataFromURL(uri string, localLocationo string, wg *sync.WaitGroup) {
-	log.Println("Scraping", uri)   // Log the URL being scraped
-	response, err := http.Get(uri) // Perform GET request
+	response, err := http.DefaultClient.Do(req) // Perform GET request
 	if err != nil {
-		log.Fatalln(err) // Exit if request fails
+		return "", false, err
 	}
+	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body) // Read response body
-	if err != nil {
-		log.Fatalln(err) // Exit if read fails
+	if response.StatusCode == http.StatusNotModified {
+		return "", true, nil
 	}
 
-	err = response.Body.Close() // Close response body
+	rawBody, err := io.ReadAll(response.Body) // Read response body
 	if err != nil {
-		log.Fatalln(err) // Exit if close fails
+		return "", false, err
 	}
 
-	// Write the data to file.
-	appendAndWriteToFile(localLocationo, string(body))
-	// Waitgroup done.
-	defer wg.Done() // Decrement WaitGroup counter
+	cache.set(uri, httpValidators{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")})
+
+	return string(rawBody), false, nil
 }